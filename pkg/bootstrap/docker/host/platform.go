@@ -0,0 +1,177 @@
+package host
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/run"
+)
+
+// HostPlatform abstracts the host-specific parts of Start/TestPorts that
+// differ by Docker daemon. Obtain one through DetectHostPlatform.
+type HostPlatform interface {
+	// RequiredBinds returns the host bind mounts the OpenShift container
+	// needs in order to manage the host's networking, process, and
+	// storage state.
+	RequiredBinds() []string
+
+	// PortInUse reports which of the given ports are already bound on
+	// the Docker host.
+	PortInUse(ports []int) ([]int, error)
+
+	// HostRootFS returns the path, as seen from inside the OpenShift
+	// container, at which the Docker host's root filesystem is mounted.
+	HostRootFS() string
+}
+
+// DetectHostPlatform picks a HostPlatform implementation based on
+// client.Info(). image is used to run short-lived containers when a
+// platform needs to inspect the host itself (e.g. LinuxHost's procfs read).
+func DetectHostPlatform(client *docker.Client, image string) (HostPlatform, error) {
+	info, err := client.Info()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine Docker host platform: %v", err)
+	}
+
+	os := strings.ToLower(info.OperatingSystem)
+	switch {
+	case strings.Contains(os, "boot2docker"), strings.Contains(os, "docker desktop"), strings.Contains(os, "moby"):
+		return &MobyVMHost{client: client}, nil
+	case strings.Contains(os, "solaris"), strings.EqualFold(info.OSType, "solaris"):
+		return &SolarisHost{client: client}, nil
+	default:
+		return &LinuxHost{client: client, image: image}, nil
+	}
+}
+
+// LinuxHost is the default platform, used when the Docker daemon runs
+// directly on a Linux kernel.
+type LinuxHost struct {
+	client *docker.Client
+	image  string
+}
+
+func (h *LinuxHost) RequiredBinds() []string {
+	return []string{
+		fmt.Sprintf("/:%s:ro", h.HostRootFS()),
+		"/var/run:/var/run:rw",
+		"/sys:/sys:ro",
+		"/var/lib/docker:/var/lib/docker",
+	}
+}
+
+func (h *LinuxHost) PortInUse(ports []int) ([]int, error) {
+	portData, _, err := run.NewRunHelper(h.client).New().Image(h.image).
+		DiscardContainer().
+		Privileged().
+		HostNetwork().
+		HostPid().
+		Entrypoint("/bin/bash").
+		Command("-c", "cat /proc/net/tcp /proc/net/tcp6").
+		CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get TCP port information from Kubernetes host: %v", err)
+	}
+	return portsInUse(portData, ports), nil
+}
+
+func (h *LinuxHost) HostRootFS() string {
+	return "/rootfs"
+}
+
+// portsInUse parses `/proc/net/tcp{,6}` output and returns which of the
+// given ports are in the listening state.
+func portsInUse(data string, ports []int) []int {
+	used := map[int]struct{}{}
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) < 4 || !strings.Contains(parts[0], ":") {
+			continue
+		}
+		localAddress := strings.Split(parts[1], ":")
+		if len(localAddress) < 2 {
+			continue
+		}
+		if parts[3] != "0A" { // only connections in the listening state
+			continue
+		}
+		if port, err := strconv.ParseInt(localAddress[1], 16, 0); err == nil {
+			used[int(port)] = struct{}{}
+		}
+	}
+	conflicts := []int{}
+	for _, port := range ports {
+		if _, inUse := used[port]; inUse {
+			conflicts = append(conflicts, port)
+		}
+	}
+	return conflicts
+}
+
+// MobyVMHost is used when the Docker daemon runs inside a VM rather than
+// on the caller's own kernel, so there is no host `/` or `/sys` to mount.
+type MobyVMHost struct {
+	client *docker.Client
+}
+
+func (h *MobyVMHost) RequiredBinds() []string {
+	return []string{
+		"/var/run:/var/run:rw",
+		"/var/lib/docker:/var/lib/docker",
+	}
+}
+
+func (h *MobyVMHost) PortInUse(ports []int) ([]int, error) {
+	return portsInUseFromContainerList(h.client, ports)
+}
+
+func (h *MobyVMHost) HostRootFS() string {
+	return ""
+}
+
+// SolarisHost is used when the Docker daemon runs in a Solaris zone.
+type SolarisHost struct {
+	client *docker.Client
+}
+
+func (h *SolarisHost) RequiredBinds() []string {
+	return []string{
+		"/var/run:/var/run:rw",
+		"/var/lib/docker:/var/lib/docker",
+	}
+}
+
+func (h *SolarisHost) PortInUse(ports []int) ([]int, error) {
+	return portsInUseFromContainerList(h.client, ports)
+}
+
+func (h *SolarisHost) HostRootFS() string {
+	return ""
+}
+
+// portsInUseFromContainerList asks the Docker API for every published
+// container port instead of shelling out to `ss`/`netstat`.
+func portsInUseFromContainerList(client *docker.Client, ports []int) ([]int, error) {
+	containers, err := client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list containers to determine port usage: %v", err)
+	}
+	used := map[int]struct{}{}
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				used[int(p.PublicPort)] = struct{}{}
+			}
+		}
+	}
+	conflicts := []int{}
+	for _, port := range ports {
+		if _, inUse := used[port]; inUse {
+			conflicts = append(conflicts, port)
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,57 @@
+package host
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+func TestPortsInUse(t *testing.T) {
+	// sl  local_address rem_address   st ...
+	data := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 00000000:01BB 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 ffff\n" + // :443 listening
+		"   1: 00000000:0050 00000000:0000 06 00000000:00000000 00:00000000 00000000     0        0 2 1 ffff\n" + // :80 TIME_WAIT, not listening
+		"   2: 0100007F:270F 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3 1 ffff\n" // :9999 listening
+
+	conflicts := portsInUse(data, []int{443, 80, 9999, 22})
+	want := map[int]bool{443: true, 9999: true}
+	if len(conflicts) != len(want) {
+		t.Fatalf("expected conflicts %v, got %v", want, conflicts)
+	}
+	for _, port := range conflicts {
+		if !want[port] {
+			t.Errorf("unexpected port %d reported in use", port)
+		}
+	}
+}
+
+func TestPortsInUseFromContainerList(t *testing.T) {
+	containers := []docker.APIContainers{
+		{Ports: []docker.APIPort{
+			{PrivatePort: 8443, PublicPort: 8443},
+			{PrivatePort: 80, PublicPort: 0},
+		}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(containers); err != nil {
+			t.Fatalf("unexpected error encoding fake container list: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conflicts, err := portsInUseFromContainerList(client, []int{8443, 80, 53})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0] != 8443 {
+		t.Fatalf("expected only published port 8443 to be reported in use, got %v", conflicts)
+	}
+}
@@ -0,0 +1,146 @@
+package openshift
+
+import (
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/kubernetes/pkg/util/strategicpatch"
+
+	configapi "github.com/openshift/origin/pkg/cmd/server/api"
+	configapilatest "github.com/openshift/origin/pkg/cmd/server/api/latest"
+)
+
+// ConfigMutator is a single step in the overlay pipeline applied to a
+// freshly generated master configuration before it is written back to the
+// Docker host. Mutators run in the order they are declared, so a later
+// mutator can see and further adjust the work of an earlier one.
+type ConfigMutator interface {
+	Mutate(*configapi.MasterConfig) error
+}
+
+// NodeConfigMutator is the node-config counterpart to ConfigMutator.
+type NodeConfigMutator interface {
+	Mutate(*configapi.NodeConfig) error
+}
+
+// ConfigMutatorFunc adapts a plain function to a ConfigMutator.
+type ConfigMutatorFunc func(*configapi.MasterConfig) error
+
+func (f ConfigMutatorFunc) Mutate(cfg *configapi.MasterConfig) error {
+	return f(cfg)
+}
+
+// NodeConfigMutatorFunc adapts a plain function to a NodeConfigMutator.
+type NodeConfigMutatorFunc func(*configapi.NodeConfig) error
+
+func (f NodeConfigMutatorFunc) Mutate(cfg *configapi.NodeConfig) error {
+	return f(cfg)
+}
+
+// NodeIPMutator stamps the kubelet NodeIP of a node config.
+func NodeIPMutator(nodeIP string) NodeConfigMutator {
+	return NodeConfigMutatorFunc(func(cfg *configapi.NodeConfig) error {
+		cfg.NodeIP = nodeIP
+		return nil
+	})
+}
+
+// RoutingSubdomainMutator sets the router's wildcard subdomain to exactly
+// the given value; it does not derive a default when subdomain is empty
+// (updateConfig picks the <serverIP>.xip.io default before calling it).
+func RoutingSubdomainMutator(subdomain string) ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		cfg.RoutingConfig.Subdomain = subdomain
+		return nil
+	})
+}
+
+// AssetPublicURLMutator overrides the web console's public URL, useful when
+// the cluster is reachable through a different address than the one it was
+// bootstrapped with (e.g. behind a load balancer).
+func AssetPublicURLMutator(publicURL string) ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		if cfg.AssetConfig != nil {
+			cfg.AssetConfig.PublicURL = publicURL
+		}
+		return nil
+	})
+}
+
+// IdentityProviderMutator replaces the master's configured identity
+// providers (htpasswd, allow-all, request-header, ...). OAuthConfig is nil
+// when the generated master config didn't enable OAuth, so this allocates
+// one rather than silently dropping the requested providers.
+func IdentityProviderMutator(providers []configapi.IdentityProvider) ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		if cfg.OAuthConfig == nil {
+			cfg.OAuthConfig = &configapi.OAuthConfig{}
+		}
+		cfg.OAuthConfig.IdentityProviders = providers
+		return nil
+	})
+}
+
+// AdmissionPluginMutator merges additional admission plugin configuration
+// into the master config, without disturbing plugins it doesn't mention.
+func AdmissionPluginMutator(pluginConfig map[string]configapi.AdmissionPluginConfig) ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		if cfg.AdmissionConfig.PluginConfig == nil {
+			cfg.AdmissionConfig.PluginConfig = map[string]configapi.AdmissionPluginConfig{}
+		}
+		for name, pc := range pluginConfig {
+			cfg.AdmissionConfig.PluginConfig[name] = pc
+		}
+		return nil
+	})
+}
+
+// MultitenantSDNMutator switches the SDN plugin to the multitenant network
+// plugin so that `cluster up` can exercise project network isolation.
+func MultitenantSDNMutator() ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		cfg.NetworkConfig.NetworkPluginName = "redhat/openshift-ovs-multitenant"
+		return nil
+	})
+}
+
+// ImagePolicyMutator replaces the master's image policy configuration.
+func ImagePolicyMutator(policy configapi.ImagePolicyConfig) ConfigMutator {
+	return ConfigMutatorFunc(func(cfg *configapi.MasterConfig) error {
+		cfg.ImagePolicyConfig = policy
+		return nil
+	})
+}
+
+// applyConfigPatch merges the strategic-merge patch found at patchFile into
+// cfg, letting `cluster up` callers enable features without hand-editing
+// the generated master-config.yaml afterwards. The patch file is YAML (per
+// --config-patch <file.yaml>), but strategicpatch.StrategicMergePatch only
+// understands JSON, so both sides are converted before merging.
+func applyConfigPatch(cfg *configapi.MasterConfig, patchFile string) (*configapi.MasterConfig, error) {
+	patchYAML, err := ioutil.ReadFile(patchFile)
+	if err != nil {
+		return nil, err
+	}
+	patchJSON, err := yaml.YAMLToJSON(patchYAML)
+	if err != nil {
+		return nil, err
+	}
+	cfgYAML, err := configapilatest.WriteYAML(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfgJSON, err := yaml.YAMLToJSON(cfgYAML)
+	if err != nil {
+		return nil, err
+	}
+	mergedJSON, err := strategicpatch.StrategicMergePatch(cfgJSON, patchJSON, &configapi.MasterConfig{})
+	if err != nil {
+		return nil, err
+	}
+	merged, err := configapilatest.ReadMasterConfigData(mergedJSON)
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
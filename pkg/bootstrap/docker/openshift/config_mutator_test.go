@@ -0,0 +1,95 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	configapi "github.com/openshift/origin/pkg/cmd/server/api"
+)
+
+func TestRoutingSubdomainMutator(t *testing.T) {
+	cfg := &configapi.MasterConfig{}
+	if err := RoutingSubdomainMutator("example.com").Mutate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RoutingConfig.Subdomain != "example.com" {
+		t.Errorf("expected subdomain %q, got %q", "example.com", cfg.RoutingConfig.Subdomain)
+	}
+}
+
+func TestMultitenantSDNMutator(t *testing.T) {
+	cfg := &configapi.MasterConfig{}
+	if err := MultitenantSDNMutator().Mutate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.NetworkConfig.NetworkPluginName != "redhat/openshift-ovs-multitenant" {
+		t.Errorf("expected multitenant plugin, got %q", cfg.NetworkConfig.NetworkPluginName)
+	}
+}
+
+func TestAdmissionPluginMutatorMerges(t *testing.T) {
+	cfg := &configapi.MasterConfig{}
+	cfg.AdmissionConfig.PluginConfig = map[string]configapi.AdmissionPluginConfig{
+		"existing": {Location: "existing.yaml"},
+	}
+	err := AdmissionPluginMutator(map[string]configapi.AdmissionPluginConfig{
+		"new": {Location: "new.yaml"},
+	}).Mutate(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.AdmissionConfig.PluginConfig) != 2 {
+		t.Fatalf("expected existing plugin config to be preserved, got %#v", cfg.AdmissionConfig.PluginConfig)
+	}
+}
+
+func TestIdentityProviderMutatorAllocatesOAuthConfig(t *testing.T) {
+	cfg := &configapi.MasterConfig{}
+	providers := []configapi.IdentityProvider{{Name: "htpasswd"}}
+	if err := IdentityProviderMutator(providers).Mutate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.OAuthConfig == nil {
+		t.Fatalf("expected OAuthConfig to be allocated, got nil")
+	}
+	if len(cfg.OAuthConfig.IdentityProviders) != 1 || cfg.OAuthConfig.IdentityProviders[0].Name != "htpasswd" {
+		t.Errorf("expected identity providers to be set, got %#v", cfg.OAuthConfig.IdentityProviders)
+	}
+}
+
+func TestNodeIPMutator(t *testing.T) {
+	cfg := &configapi.NodeConfig{}
+	if err := NodeIPMutator("10.0.0.5").Mutate(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.NodeIP != "10.0.0.5" {
+		t.Errorf("expected NodeIP %q, got %q", "10.0.0.5", cfg.NodeIP)
+	}
+}
+
+func TestApplyConfigPatch(t *testing.T) {
+	cfg := &configapi.MasterConfig{}
+	cfg.RoutingConfig.Subdomain = "original.example.com"
+
+	patchDir, err := ioutil.TempDir("", "config-patch-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(patchDir)
+
+	patchFile := filepath.Join(patchDir, "patch.yaml")
+	patchYAML := "routingConfig:\n  subdomain: patched.example.com\n"
+	if err := ioutil.WriteFile(patchFile, []byte(patchYAML), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	merged, err := applyConfigPatch(cfg, patchFile)
+	if err != nil {
+		t.Fatalf("applyConfigPatch returned error for a YAML patch file: %v", err)
+	}
+	if merged.RoutingConfig.Subdomain != "patched.example.com" {
+		t.Errorf("expected patched subdomain, got %q", merged.RoutingConfig.Subdomain)
+	}
+}
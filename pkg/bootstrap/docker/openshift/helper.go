@@ -2,12 +2,10 @@ package openshift
 
 import (
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -25,23 +23,16 @@ import (
 )
 
 const (
-	initialStatusCheckWait = 4 * time.Second
-	serverUpTimeout        = 35
-	serverMasterConfig     = "/var/lib/origin/openshift.local.config/master/master-config.yaml"
+	serverMasterConfig = "/var/lib/origin/openshift.local.config/master/master-config.yaml"
 )
 
 var (
-	openShiftContainerBinds = []string{
-		"/:/rootfs:ro",
-		"/var/run:/var/run:rw",
-		"/sys:/sys:ro",
-		"/var/lib/docker:/var/lib/docker",
-	}
 	tcpPorts = []int{53, 80, 443, 4001, 7001, 8443, 10250}
 )
 
 // Helper contains methods and utilities to help with OpenShift startup
 type Helper struct {
+	client        *docker.Client
 	hostHelper    *host.HostHelper
 	dockerHelper  *dockerhelper.Helper
 	execHelper    *exec.ExecHelper
@@ -50,6 +41,16 @@ type Helper struct {
 	image         string
 	containerName string
 	routingSuffix string
+
+	// hostPlatform is lazily detected on first use so that NewHelper does
+	// not need to talk to the Docker daemon just to construct a Helper.
+	hostPlatform host.HostPlatform
+
+	// reporter receives structured progress events in place of the
+	// free-form glog/fmt.Fprintf calls Start used to make directly.
+	// Defaults to a TextReporter writing to stdout; use SetReporter to
+	// install a JSONReporter for `cluster up --json` and similar.
+	reporter Reporter
 }
 
 // StartOptions represent the parameters sent to the start command
@@ -63,11 +64,35 @@ type StartOptions struct {
 	UseExistingConfig bool
 	Environment       []string
 	LogLevel          int
+
+	// NodeNames declares the hostnames of the additional nodes that will
+	// join this cluster after the master is up. A bootstrap kubeconfig is
+	// written and signed for each of them by StartMaster.
+	NodeNames []string
+
+	// StartTimeout bounds how long Start waits for the container to
+	// report itself ready before giving up. Defaults to 5 minutes.
+	StartTimeout time.Duration
+
+	// MasterConfigMutators run, in order, against the generated master
+	// config before it is written back to the Docker host. This is the
+	// programmatic equivalent of ConfigPatchFile and lets callers (tests,
+	// CI, `cluster up` flags) enable features without hand-editing YAML.
+	MasterConfigMutators []ConfigMutator
+
+	// NodeConfigMutators run, in order, against each node's generated
+	// config after the default NodeIP mutator has stamped it.
+	NodeConfigMutators []NodeConfigMutator
+
+	// ConfigPatchFile, if set, names a strategic-merge patch file applied
+	// to the generated master config after MasterConfigMutators have run.
+	ConfigPatchFile string
 }
 
 // NewHelper creates a new OpenShift helper
 func NewHelper(client *docker.Client, hostHelper *host.HostHelper, image, containerName, publicHostname, routingSuffix string) *Helper {
 	return &Helper{
+		client:        client,
 		dockerHelper:  dockerhelper.NewHelper(client),
 		execHelper:    exec.NewExecHelper(client, containerName),
 		hostHelper:    hostHelper,
@@ -76,28 +101,41 @@ func NewHelper(client *docker.Client, hostHelper *host.HostHelper, image, contai
 		containerName: containerName,
 		publicHost:    publicHostname,
 		routingSuffix: routingSuffix,
+		reporter:      NewTextReporter(os.Stdout),
 	}
 }
 
+// SetReporter installs r as the Helper's Reporter, replacing the default
+// TextReporter. Pass a JSONReporter to make `cluster up` output
+// newline-delimited JSON instead of human-readable text.
+func (h *Helper) SetReporter(r Reporter) {
+	h.reporter = r
+}
+
 func (h *Helper) TestPorts() error {
-	portData, _, err := h.runHelper.New().Image(h.image).
-		DiscardContainer().
-		Privileged().
-		HostNetwork().
-		HostPid().
-		Entrypoint("/bin/bash").
-		Command("-c", "cat /proc/net/tcp /proc/net/tcp6").
-		CombinedOutput()
+	h.reporter.PhaseStarted("Checking required ports", nil)
+	platform, err := h.getHostPlatform()
+	if err != nil {
+		h.reporter.PhaseFailed("Checking required ports", err, nil)
+		return err
+	}
+	conflicts, err := platform.PortInUse(tcpPorts)
 	if err != nil {
-		return errors.NewError("Cannot get TCP port information from Kubernetes host").WithCause(err)
+		testErr := errors.NewError("Cannot get TCP port information from Kubernetes host").WithCause(err)
+		h.reporter.PhaseFailed("Checking required ports", testErr, nil)
+		return testErr
 	}
-	if err = checkPortsInUse(portData, tcpPorts); err != nil {
-		return errors.NewError("TCP port conflict").WithCause(err)
+	if len(conflicts) > 0 {
+		conflictErr := errors.NewError("the following required ports are in use: %v", conflicts)
+		h.reporter.PhaseFailed("Checking required ports", conflictErr, Fields{"ports": conflicts})
+		return conflictErr
 	}
+	h.reporter.PhaseCompleted("Checking required ports", nil)
 	return nil
 }
 
 func (h *Helper) TestIP(ip string) error {
+	h.reporter.PhaseStarted("Checking Docker host IP reachability", Fields{"ip": ip})
 
 	// Start test server on host
 	id, err := h.runHelper.New().Image(h.image).
@@ -106,7 +144,9 @@ func (h *Helper) TestIP(ip string) error {
 		Entrypoint("socat").
 		Command("TCP-LISTEN:8443,crlf,reuseaddr,fork", "SYSTEM:\"echo 'hello world'\"").Start()
 	if err != nil {
-		return errors.NewError("cannnot start simple server on Docker host").WithCause(err)
+		testErr := errors.NewError("cannnot start simple server on Docker host").WithCause(err)
+		h.reporter.PhaseFailed("Checking Docker host IP reachability", testErr, nil)
+		return testErr
 	}
 	defer func() {
 		errors.LogError(h.dockerHelper.StopAndRemoveContainer(id))
@@ -114,12 +154,11 @@ func (h *Helper) TestIP(ip string) error {
 
 	// Attempt to connect to test container
 	testHost := fmt.Sprintf("%s:8443", ip)
-	glog.V(4).Infof("Attempting to dial %s", testHost)
 	if err := cmdutil.WaitForSuccessfulDial(false, "tcp", testHost, 200*time.Millisecond, 1*time.Second, 10); err != nil {
-		glog.V(2).Infof("Dial error: %v", err)
+		h.reporter.PhaseFailed("Checking Docker host IP reachability", err, Fields{"host": testHost})
 		return err
 	}
-	glog.V(4).Infof("Successfully dialed %s", testHost)
+	h.reporter.PhaseCompleted("Checking Docker host IP reachability", nil)
 	return nil
 }
 
@@ -160,10 +199,22 @@ func (h *Helper) OtherIPs(excludeIP string) ([]string, error) {
 
 // Start starts the OpenShift master as a Docker container
 // and returns a directory in the local file system where
-// the OpenShift configuration has been copied
-func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
-	binds := openShiftContainerBinds
+// the OpenShift configuration has been copied. Progress is reported
+// through h.reporter; use SetReporter before calling Start to change how
+// it is rendered.
+func (h *Helper) Start(opt *StartOptions) (string, error) {
+	platform, err := h.getHostPlatform()
+	if err != nil {
+		return "", err
+	}
+	binds := platform.RequiredBinds()
 	env := []string{}
+
+	txn := newTransaction(h.client, h.dockerHelper)
+	defer func() {
+		errors.LogError(txn.Rollback())
+	}()
+
 	if opt.UseSharedVolume {
 		binds = append(binds, fmt.Sprintf("%[1]s:%[1]s:shared", opt.HostVolumesDir))
 		env = append(env, "OPENSHIFT_CONTAINERIZED=false")
@@ -173,12 +224,13 @@ func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
 	env = append(env, opt.Environment...)
 	binds = append(binds, fmt.Sprintf("%s:/var/lib/origin/openshift.local.config:z", opt.HostConfigDir))
 
+	if err := h.ensureImage(txn); err != nil {
+		return "", err
+	}
+
 	// Check if a configuration exists before creating one if UseExistingConfig
 	// was specified
 	var configDir string
-	cleanupConfig := func() {
-		errors.LogError(os.RemoveAll(configDir))
-	}
 	skipCreateConfig := false
 	if opt.UseExistingConfig {
 		var err error
@@ -193,8 +245,7 @@ func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
 
 	// Create configuration if needed
 	if !skipCreateConfig {
-		glog.V(1).Infof("Creating openshift configuration at %s on Docker host", opt.HostConfigDir)
-		fmt.Fprintf(out, "Creating initial OpenShift configuration\n")
+		h.reporter.PhaseStarted("Creating initial OpenShift configuration", Fields{"hostConfigDir": opt.HostConfigDir})
 		createConfigCmd := []string{
 			"start",
 			fmt.Sprintf("--images=openshift/origin-${component}:%s", opt.ImageTag),
@@ -215,25 +266,29 @@ func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
 			Env(env...).
 			Command(createConfigCmd...).Run()
 		if err != nil {
-			return "", errors.NewError("could not create OpenShift configuration").WithCause(err)
+			createErr := errors.NewError("could not create OpenShift configuration").WithCause(err)
+			h.reporter.PhaseFailed("Creating initial OpenShift configuration", createErr, nil)
+			return "", createErr
 		}
 		configDir, err = h.copyConfig(opt.HostConfigDir)
 		if err != nil {
 			return "", errors.NewError("could not copy OpenShift configuration").WithCause(err)
 		}
-		err = h.updateConfig(configDir, opt.HostConfigDir, opt.ServerIP)
+		txn.addTempDir(configDir)
+		err = h.updateConfig(configDir, opt.HostConfigDir, opt.ServerIP, opt)
 		if err != nil {
-			cleanupConfig()
 			return "", errors.NewError("could not update OpenShift configuration").WithCause(err)
 		}
+		h.reporter.PhaseCompleted("Creating initial OpenShift configuration", nil)
+	} else {
+		txn.addTempDir(configDir)
 	}
 	masterConfig, nodeConfig, err := h.getOpenShiftConfigFiles()
 	if err != nil {
-		cleanupConfig()
 		return "", errors.NewError("could not get OpenShift configuration file paths").WithCause(err)
 	}
 
-	fmt.Fprintf(out, "Starting OpenShift using container '%s'\n", h.containerName)
+	h.reporter.PhaseStarted("Starting OpenShift", Fields{"container": h.containerName})
 	startCmd := []string{
 		"start",
 		fmt.Sprintf("--master-config=%s", masterConfig),
@@ -246,7 +301,17 @@ func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
 	if len(opt.HostDataDir) > 0 {
 		binds = append(binds, fmt.Sprintf("%s:/var/lib/origin/openshift.local.etcd:z", opt.HostDataDir))
 	}
-	_, err = h.runHelper.New().Image(h.image).
+
+	// Subscribe before creating the container so a "die" event racing
+	// with creation is queued rather than missed by a listener that
+	// registers only after Start() has already returned.
+	events, err := h.subscribeEvents()
+	if err != nil {
+		h.reporter.PhaseFailed("Starting OpenShift", err, nil)
+		return "", err
+	}
+
+	containerID, err := h.runHelper.New().Image(h.image).
 		Name(h.containerName).
 		Privileged().
 		HostNetwork().
@@ -256,54 +321,50 @@ func (h *Helper) Start(opt *StartOptions, out io.Writer) (string, error) {
 		Command(startCmd...).
 		Start()
 	if err != nil {
-		return "", errors.NewError("cannot start OpenShift daemon").WithCause(err)
-	}
-
-	// Wait a minimum amount of time and check whether we're still running. If not, we know the daemon didn't start
-	time.Sleep(initialStatusCheckWait)
-	_, running, err := h.dockerHelper.GetContainerState(h.containerName)
-	if err != nil {
-		return "", errors.NewError("cannot get state of OpenShift container %s", h.containerName).WithCause(err)
-	}
-	if !running {
-		return "", ErrOpenShiftFailedToStart(h.containerName)
+		h.client.RemoveEventListener(events)
+		startErr := errors.NewError("cannot start OpenShift daemon").WithCause(err)
+		h.reporter.PhaseFailed("Starting OpenShift", startErr, nil)
+		return "", startErr
 	}
+	txn.addContainer(containerID)
 
-	// Wait until the API server is listening
-	fmt.Fprintf(out, "Waiting for API server to start listening\n")
-	masterHost := fmt.Sprintf("%s:8443", opt.ServerIP)
-	if err := cmdutil.WaitForSuccessfulDial(true, "tcp", masterHost, 200*time.Millisecond, 1*time.Second, serverUpTimeout); err != nil {
-		return "", ErrTimedOutWaitingForStart(h.containerName)
+	// Wait for the container to reach Ready: Docker events drive the
+	// state machine instead of fixed sleeps and polling loops.
+	progress := func(state, detail string) {
+		h.reporter.Info(state, Fields{"detail": detail})
 	}
-	// Check for healthz endpoint to be ready
-	client, err := masterHTTPClient(configDir)
-	if err != nil {
+	if err := h.waitForReady(containerID, events, opt, opt.ServerIP, configDir, progress); err != nil {
+		h.reporter.PhaseFailed("Starting OpenShift", err, nil)
 		return "", err
 	}
-	for {
-		resp, ierr := client.Get(h.healthzReadyURL(opt.ServerIP))
-		if ierr != nil {
-			return "", errors.NewError("cannot access master readiness URL %s", h.healthzReadyURL(opt.ServerIP)).WithCause(err)
-		}
-		if resp.StatusCode == http.StatusOK {
-			break
-		}
-		if resp.StatusCode == http.StatusServiceUnavailable ||
-			resp.StatusCode == http.StatusForbidden {
-			time.Sleep(500 * time.Millisecond)
-			continue
-		}
-		var responseBody string
-		body, rerr := ioutil.ReadAll(resp.Body)
-		if rerr == nil {
-			responseBody = string(body)
-		}
-		return "", errors.NewError("server is not ready. Response (%d): %s", resp.StatusCode, responseBody).WithCause(ierr)
-	}
-	fmt.Fprintf(out, "OpenShift server started\n")
+	h.reporter.PhaseCompleted("Starting OpenShift", nil)
+	txn.Commit()
 	return configDir, nil
 }
 
+// ensureImage pulls h.image if it is not already present locally, and
+// records the pull on txn so that a failed Start removes the image it
+// fetched rather than leaving one behind that a prior invocation already
+// had cached.
+func (h *Helper) ensureImage(txn *Transaction) error {
+	if _, err := h.client.InspectImage(h.image); err == nil {
+		return nil
+	}
+	repository, tag := h.image, "latest"
+	if idx := strings.LastIndex(h.image, ":"); idx != -1 {
+		repository, tag = h.image[:idx], h.image[idx+1:]
+	}
+	h.reporter.PhaseStarted("Pulling OpenShift container image", Fields{"image": h.image})
+	if err := h.client.PullImage(docker.PullImageOptions{Repository: repository, Tag: tag}, docker.AuthConfiguration{}); err != nil {
+		pullErr := errors.NewError("could not pull image %s", h.image).WithCause(err)
+		h.reporter.PhaseFailed("Pulling OpenShift container image", pullErr, nil)
+		return pullErr
+	}
+	h.reporter.PhaseCompleted("Pulling OpenShift container image", nil)
+	txn.addPulledImage(h.image)
+	return nil
+}
+
 func (h *Helper) healthzReadyURL(ip string) string {
 	return fmt.Sprintf("%s/healthz/ready", h.Master(ip))
 }
@@ -341,19 +402,35 @@ func (h *Helper) copyConfig(hostDir string) (string, error) {
 	return tempDir, nil
 }
 
-func (h *Helper) updateConfig(configDir, hostDir, serverIP string) error {
+// updateConfig runs the config overlay pipeline against the generated
+// master config: the default routing subdomain mutator, any caller-supplied
+// opt.MasterConfigMutators, and finally opt.ConfigPatchFile if set.
+func (h *Helper) updateConfig(configDir, hostDir, serverIP string, opt *StartOptions) error {
+	h.reporter.PhaseStarted("Applying OpenShift configuration overlay", Fields{"masterConfigDir": configDir})
 	masterConfig := filepath.Join(configDir, "master", "master-config.yaml")
-	glog.V(1).Infof("Reading master config from %s", masterConfig)
 	cfg, err := configapilatest.ReadMasterConfig(masterConfig)
 	if err != nil {
-		glog.V(1).Infof("Could not read master config: %v", err)
-		return err
+		overlayErr := errors.NewError("could not read master config %s", masterConfig).WithCause(err)
+		h.reporter.PhaseFailed("Applying OpenShift configuration overlay", overlayErr, nil)
+		return overlayErr
 	}
 
+	subdomain := fmt.Sprintf("%s.xip.io", serverIP)
 	if len(h.routingSuffix) > 0 {
-		cfg.RoutingConfig.Subdomain = h.routingSuffix
-	} else {
-		cfg.RoutingConfig.Subdomain = fmt.Sprintf("%s.xip.io", serverIP)
+		subdomain = h.routingSuffix
+	}
+	mutators := append([]ConfigMutator{RoutingSubdomainMutator(subdomain)}, opt.MasterConfigMutators...)
+	for _, mutator := range mutators {
+		if err := mutator.Mutate(cfg); err != nil {
+			return err
+		}
+	}
+
+	if len(opt.ConfigPatchFile) > 0 {
+		cfg, err = applyConfigPatch(cfg, opt.ConfigPatchFile)
+		if err != nil {
+			return err
+		}
 	}
 
 	cfgBytes, err := configapilatest.WriteYAML(cfg)
@@ -364,7 +441,48 @@ func (h *Helper) updateConfig(configDir, hostDir, serverIP string) error {
 	if err != nil {
 		return err
 	}
-	return h.hostHelper.CopyMasterConfigToHost(masterConfig, hostDir)
+	if err := h.stampNodeConfigs(configDir, serverIP, opt.NodeConfigMutators); err != nil {
+		return err
+	}
+	if err := h.hostHelper.CopyMasterConfigToHost(masterConfig, hostDir); err != nil {
+		return err
+	}
+	h.reporter.PhaseCompleted("Applying OpenShift configuration overlay", nil)
+	return nil
+}
+
+// stampNodeConfigs runs the default NodeIP mutator plus any caller-supplied
+// mutators against every node-<hostname> config found under configDir. The
+// all-in-one node always binds to serverIP; nodes joined later via
+// JoinNode stamp their own IP when they start, so this only needs to cover
+// the node directory the master wrote for itself.
+func (h *Helper) stampNodeConfigs(configDir, serverIP string, extra []NodeConfigMutator) error {
+	nodeConfigs, err := h.getAllNodeConfigFiles(configDir)
+	if err != nil {
+		return err
+	}
+	mutators := append([]NodeConfigMutator{NodeIPMutator(serverIP)}, extra...)
+	for hostname := range nodeConfigs {
+		nodeConfigFile := filepath.Join(configDir, nodeConfigDirPrefix+hostname, "node-config.yaml")
+		cfg, err := configapilatest.ReadNodeConfig(nodeConfigFile)
+		if err != nil {
+			glog.V(1).Infof("Could not read node config %s: %v", nodeConfigFile, err)
+			return err
+		}
+		for _, mutator := range mutators {
+			if err := mutator.Mutate(cfg); err != nil {
+				return err
+			}
+		}
+		cfgBytes, err := configapilatest.WriteYAML(cfg)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(nodeConfigFile, cfgBytes, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (h *Helper) getOpenShiftConfigFiles() (string, string, error) {
@@ -373,50 +491,38 @@ func (h *Helper) getOpenShiftConfigFiles() (string, string, error) {
 		return "", "", err
 	}
 	return "/var/lib/origin/openshift.local.config/master/master-config.yaml",
-		fmt.Sprintf("/var/lib/origin/openshift.local.config/node-%s/node-config.yaml", hostname),
+		nodeConfigPath(hostname),
 		nil
 }
 
-func checkPortsInUse(data string, ports []int) error {
-	used := getUsedPorts(data)
-	conflicts := []int{}
-	for _, port := range ports {
-		if _, inUse := used[port]; inUse {
-			conflicts = append(conflicts, port)
-		}
+// getAllNodeConfigFiles enumerates every node-<hostname> directory found
+// under configDir and returns the in-container path to each node's
+// node-config.yaml, keyed by hostname.
+func (h *Helper) getAllNodeConfigFiles(configDir string) (map[string]string, error) {
+	hostnames, err := allNodeConfigDirs(configDir)
+	if err != nil {
+		return nil, err
 	}
-	if len(conflicts) > 0 {
-		return fmt.Errorf("the following required ports are in use: %v", conflicts)
+	nodeConfigs := map[string]string{}
+	for _, hostname := range hostnames {
+		nodeConfigs[hostname] = nodeConfigPath(hostname)
 	}
-	return nil
+	return nodeConfigs, nil
 }
 
-func getUsedPorts(data string) map[int]struct{} {
-	ports := map[int]struct{}{}
-	lines := strings.Split(data, "\n")
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
-		// discard lines that don't contain connection data
-		if !strings.Contains(parts[0], ":") {
-			continue
-		}
-		glog.V(5).Infof("Determining port in use from: %s", line)
-		localAddress := strings.Split(parts[1], ":")
-		if len(localAddress) < 2 {
-			continue
-		}
-		state := parts[3]
-		if state != "0A" { // only look at connections that are listening
-			continue
-		}
-		port, err := strconv.ParseInt(localAddress[1], 16, 0)
-		if err == nil {
-			ports[int(port)] = struct{}{}
+func nodeConfigPath(hostname string) string {
+	return fmt.Sprintf("/var/lib/origin/openshift.local.config/%s%s/node-config.yaml", nodeConfigDirPrefix, hostname)
+}
+
+// getHostPlatform detects and caches the HostPlatform for the Docker host
+// this Helper is talking to.
+func (h *Helper) getHostPlatform() (host.HostPlatform, error) {
+	if h.hostPlatform == nil {
+		platform, err := host.DetectHostPlatform(h.client, h.image)
+		if err != nil {
+			return nil, err
 		}
+		h.hostPlatform = platform
 	}
-	glog.V(2).Infof("Used ports in container: %#v", ports)
-	return ports
-}
\ No newline at end of file
+	return h.hostPlatform, nil
+}
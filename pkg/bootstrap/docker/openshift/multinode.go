@@ -0,0 +1,241 @@
+package openshift
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/errors"
+	"github.com/openshift/origin/pkg/bootstrap/docker/host"
+)
+
+const nodeConfigDirPrefix = "node-"
+
+// NodeFailure describes a joined node container that died after having
+// been started successfully.
+type NodeFailure struct {
+	NodeName string
+	Err      error
+}
+
+func (f *NodeFailure) Error() string {
+	return fmt.Sprintf("node %q failed: %v", f.NodeName, f.Err)
+}
+
+// StartMaster starts the OpenShift master as a Docker container, writing and
+// signing a bootstrap kubeconfig for every node name declared in
+// opt.NodeNames in addition to the master's own configuration. The returned
+// map associates each declared node name with the bootstrap kubeconfig that
+// should be copied to that node before calling JoinNode.
+func (h *Helper) StartMaster(opt *StartOptions) (string, map[string]string, error) {
+	configDir, err := h.Start(opt)
+	if err != nil {
+		return "", nil, err
+	}
+
+	bootstrapKubeconfigs := map[string]string{}
+	for _, nodeName := range opt.NodeNames {
+		kubeconfig, err := h.writeNodeBootstrapKubeconfig(configDir, nodeName)
+		if err != nil {
+			return configDir, bootstrapKubeconfigs, errors.NewError("could not create bootstrap kubeconfig for node %q", nodeName).WithCause(err)
+		}
+		bootstrapKubeconfigs[nodeName] = kubeconfig
+	}
+	return configDir, bootstrapKubeconfigs, nil
+}
+
+// writeNodeBootstrapKubeconfig signs a client certificate for nodeName off
+// the master's CA and assembles a kubeconfig the node can use to bootstrap
+// itself against the master.
+func (h *Helper) writeNodeBootstrapKubeconfig(configDir, nodeName string) (string, error) {
+	nodeDir := filepath.Join(configDir, nodeConfigDirPrefix+nodeName)
+	if err := os.MkdirAll(nodeDir, 0755); err != nil {
+		return "", err
+	}
+
+	kubeconfigPath := filepath.Join(nodeDir, "bootstrap.kubeconfig")
+	_, _, _, err := h.runHelper.New().Image(h.image).
+		DiscardContainer().
+		Bind(fmt.Sprintf("%s:/var/lib/origin/openshift.local.config:z", configDir)).
+		Command("admin", "create-node-config",
+			fmt.Sprintf("--node-dir=/var/lib/origin/openshift.local.config/%s%s", nodeConfigDirPrefix, nodeName),
+			fmt.Sprintf("--node=%s", nodeName),
+			"--master-config=/var/lib/origin/openshift.local.config/master/master-config.yaml",
+			"--signer-cert=/var/lib/origin/openshift.local.config/master/ca.crt",
+			"--signer-key=/var/lib/origin/openshift.local.config/master/ca.key",
+			"--signer-serial=/var/lib/origin/openshift.local.config/master/ca.serial.txt").Output()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(kubeconfigPath); err != nil {
+		return "", fmt.Errorf("expected bootstrap kubeconfig was not written to %s: %v", kubeconfigPath, err)
+	}
+	return kubeconfigPath, nil
+}
+
+// JoinNode starts an origin-node-only container on a remote Docker host,
+// using the bootstrap kubeconfig produced by StartMaster to register the
+// node with the master that kubeconfig points at; masterURL is only
+// included in the reported progress events and is not passed to the
+// container. bootstrapKubeconfig is read from the local
+// filesystem and staged into the node's config volume through the Docker
+// API, so client may point at a daemon on a different host than the one
+// running this code. The returned channel receives at most one
+// NodeFailure if the joined node container dies; it is closed after that
+// failure is sent, or when the container is destroyed. The caller has no
+// way to stop the watch earlier.
+func JoinNode(client *docker.Client, image, nodeName, masterURL, bootstrapKubeconfig string, reporter Reporter) (string, <-chan error, error) {
+	if reporter == nil {
+		reporter = NewTextReporter(os.Stdout)
+	}
+
+	platform, err := host.DetectHostPlatform(client, image)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The node config is staged via the Docker API rather than a host
+	// bind mount, so a named volume (created by the target daemon) is
+	// used in place of a path on this machine's filesystem.
+	configVolume := fmt.Sprintf("openshift-node-%s-config", nodeName)
+	binds := append(platform.RequiredBinds(), fmt.Sprintf("%s:/var/lib/origin/openshift.local.config:z", configVolume))
+
+	containerName := fmt.Sprintf("origin-node-%s", nodeName)
+	reporter.PhaseStarted("Joining node to cluster", Fields{"node": nodeName, "master": masterURL})
+
+	container, err := client.CreateContainer(docker.CreateContainerOptions{
+		Name: containerName,
+		Config: &docker.Config{
+			Image: image,
+			Cmd: []string{
+				"start", "node",
+				fmt.Sprintf("--bootstrap-config-name=%s", nodeName),
+				"--kubeconfig=/var/lib/origin/openshift.local.config/bootstrap.kubeconfig",
+				fmt.Sprintf("--hostname=%s", nodeName),
+			},
+		},
+		HostConfig: &docker.HostConfig{
+			Privileged:  true,
+			NetworkMode: "host",
+			PidMode:     "host",
+			Binds:       binds,
+		},
+	})
+	if err != nil {
+		joinErr := errors.NewError("cannot create origin-node container for %q", nodeName).WithCause(err)
+		reporter.PhaseFailed("Joining node to cluster", joinErr, Fields{"node": nodeName})
+		return "", nil, joinErr
+	}
+	id := container.ID
+
+	if err := stageNodeBootstrapKubeconfig(client, id, bootstrapKubeconfig); err != nil {
+		errors.LogError(client.RemoveContainer(docker.RemoveContainerOptions{ID: id, Force: true}))
+		joinErr := errors.NewError("could not stage bootstrap kubeconfig for node %q", nodeName).WithCause(err)
+		reporter.PhaseFailed("Joining node to cluster", joinErr, Fields{"node": nodeName})
+		return "", nil, joinErr
+	}
+
+	// Subscribe before starting the container so a "die" event racing
+	// with startup is queued in the listener's channel rather than
+	// missed by a listener that registers only after Start() returns.
+	listener := make(chan *docker.APIEvents, eventListenerBufferSize)
+	if err := client.AddEventListener(listener); err != nil {
+		errors.LogError(client.RemoveContainer(docker.RemoveContainerOptions{ID: id, Force: true}))
+		joinErr := errors.NewError("cannot watch Docker events for node %q", nodeName).WithCause(err)
+		reporter.PhaseFailed("Joining node to cluster", joinErr, Fields{"node": nodeName})
+		return "", nil, joinErr
+	}
+
+	if err := client.StartContainer(id, nil); err != nil {
+		client.RemoveEventListener(listener)
+		errors.LogError(client.RemoveContainer(docker.RemoveContainerOptions{ID: id, Force: true}))
+		joinErr := errors.NewError("cannot start origin-node container for %q", nodeName).WithCause(err)
+		reporter.PhaseFailed("Joining node to cluster", joinErr, Fields{"node": nodeName})
+		return "", nil, joinErr
+	}
+
+	failureCh := watchNodeContainer(client, listener, id, nodeName)
+	reporter.PhaseCompleted("Joining node to cluster", Fields{"node": nodeName})
+	return id, failureCh, nil
+}
+
+// stageNodeBootstrapKubeconfig reads bootstrapKubeconfig from the local
+// filesystem and uploads it into containerID's config volume through the
+// Docker API, so it lands correctly even when client points at a remote
+// daemon whose filesystem isn't shared with the machine running this code.
+func stageNodeBootstrapKubeconfig(client *docker.Client, containerID, bootstrapKubeconfig string) error {
+	data, err := ioutil.ReadFile(bootstrapKubeconfig)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "bootstrap.kubeconfig",
+		Mode: 0600,
+		Size: int64(len(data)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return client.UploadToContainer(containerID, docker.UploadToContainerOptions{
+		Path:        "/var/lib/origin/openshift.local.config",
+		InputStream: &buf,
+	})
+}
+
+// watchNodeContainer drives a goroutine off the already-subscribed
+// listener channel and forwards a NodeFailure on the returned channel if
+// id dies or is OOM-killed. listener must have been subscribed via
+// client.AddEventListener before id was started, so that a death racing
+// with container startup is still observed.
+func watchNodeContainer(client *docker.Client, listener chan *docker.APIEvents, id, nodeName string) <-chan error {
+	failureCh := make(chan error, 1)
+	go func() {
+		defer client.RemoveEventListener(listener)
+		defer close(failureCh)
+		for event := range listener {
+			if event.ID != id {
+				continue
+			}
+			switch event.Status {
+			case "die", "oom":
+				failureCh <- &NodeFailure{NodeName: nodeName, Err: fmt.Errorf("container exited with status %q", event.Status)}
+				return
+			case "destroy":
+				return
+			}
+		}
+	}()
+	return failureCh
+}
+
+// allNodeConfigDirs enumerates every node-<hostname> directory present
+// under configDir, returning the hostnames it found.
+func allNodeConfigDirs(configDir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(configDir)
+	if err != nil {
+		return nil, err
+	}
+	hostnames := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), nodeConfigDirPrefix) {
+			continue
+		}
+		hostnames = append(hostnames, strings.TrimPrefix(entry.Name(), nodeConfigDirPrefix))
+	}
+	return hostnames, nil
+}
@@ -0,0 +1,41 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestAllNodeConfigDirs(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "multinode-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(configDir)
+
+	for _, dir := range []string{"node-foo", "node-bar", "master", "node-baz"} {
+		if err := os.MkdirAll(filepath.Join(configDir, dir), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(configDir, "node-not-a-dir"), []byte("x"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hostnames, err := allNodeConfigDirs(configDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(hostnames)
+	want := []string{"bar", "baz", "foo"}
+	if len(hostnames) != len(want) {
+		t.Fatalf("expected hostnames %v, got %v", want, hostnames)
+	}
+	for i := range want {
+		if hostnames[i] != want[i] {
+			t.Fatalf("expected hostnames %v, got %v", want, hostnames)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package openshift
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/errors"
+)
+
+// readinessState enumerates the lifecycle a started OpenShift container
+// passes through on its way to serving requests.
+type readinessState string
+
+const (
+	stateCreated      readinessState = "Created"
+	stateStarted      readinessState = "Started"
+	stateAPIListening readinessState = "APIListening"
+	stateHealthzReady readinessState = "HealthzReady"
+	stateReady        readinessState = "Ready"
+)
+
+// readinessStateText maps the readiness states reported through progressFunc
+// to the human-readable sentences the CLI printed before this state machine
+// existed. States mapped to "" are intermediate progress meant for spinner
+// consumers (e.g. JSONReporter) and produce no TextReporter output, so
+// `cluster up`'s text UX is unchanged: one line when the wait starts, one
+// when it finishes.
+var readinessStateText = map[string]string{
+	string(stateCreated):      "Waiting for API server to start listening",
+	string(stateStarted):      "",
+	string(stateAPIListening): "",
+	string(stateHealthzReady): "",
+	string(stateReady):        "OpenShift server started",
+}
+
+const (
+	backoffBase = 250 * time.Millisecond
+	backoffCap  = 5 * time.Second
+	// lastLogLines is the number of trailing container log lines attached
+	// to the error returned when a container dies before becoming ready.
+	lastLogLines = 40
+)
+
+// progressFunc is invoked by the readiness watcher as the container moves
+// between states, so that CLI consumers can render progress (e.g. a
+// spinner) without depending on glog output.
+type progressFunc func(state, detail string)
+
+// eventListenerBufferSize is sized generously because subscribeEvents is
+// registered before the container it watches exists, so the channel must
+// absorb events from whatever else is happening on the Docker host (as
+// well as the watched container's own create event) until the watched
+// container's id is known and filtering can start.
+const eventListenerBufferSize = 256
+
+// subscribeEvents registers a Docker events listener and returns it
+// unfiltered. It must be called before the container whose lifecycle will
+// be watched is created, so that a "die" event racing with container
+// creation is queued in the channel rather than missed entirely.
+func (h *Helper) subscribeEvents() (chan *docker.APIEvents, error) {
+	events := make(chan *docker.APIEvents, eventListenerBufferSize)
+	if err := h.client.AddEventListener(events); err != nil {
+		return nil, errors.NewError("cannot watch Docker events for %s", h.containerName).WithCause(err)
+	}
+	return events, nil
+}
+
+// waitForReady blocks until containerID is accepting API requests and
+// reports itself healthy, or until opt.StartTimeout elapses or the
+// container dies. It replaces the old fixed-sleep-then-poll logic with an
+// event-driven state machine: Created -> Started -> APIListening ->
+// HealthzReady -> Ready. events must already be subscribed via
+// subscribeEvents before containerID was created, so that a death racing
+// with container creation is still observed.
+func (h *Helper) waitForReady(containerID string, events chan *docker.APIEvents, opt *StartOptions, serverIP, configDir string, progress progressFunc) error {
+	if progress == nil {
+		progress = func(string, string) {}
+	}
+
+	timeout := opt.StartTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+
+	// done tells every goroutine readyCh starts - the event listener and
+	// the dial/healthz backoff loops - to give up as soon as we do, so a
+	// timed-out Start doesn't leak them for the rest of the process.
+	done := make(chan struct{})
+	defer close(done)
+
+	readyCh := h.readyCh(containerID, events, opt, serverIP, configDir, progress, done)
+
+	select {
+	case err := <-readyCh:
+		return err
+	case <-time.After(timeout):
+		return ErrTimedOutWaitingForStart(h.containerName)
+	}
+}
+
+// readyCh drives the state machine off the already-subscribed events
+// channel in a goroutine, sending exactly one value (nil on success) on
+// the returned channel. Every goroutine it starts exits as soon as done
+// is closed.
+func (h *Helper) readyCh(containerID string, events chan *docker.APIEvents, opt *StartOptions, serverIP, configDir string, progress progressFunc, done <-chan struct{}) <-chan error {
+	result := make(chan error, 1)
+
+	died := make(chan string, 1)
+	go func() {
+		defer h.client.RemoveEventListener(events)
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.ID != containerID {
+					continue
+				}
+				switch event.Status {
+				case "start":
+					progress(string(stateStarted), "")
+				case "die", "oom":
+					select {
+					case died <- event.Status:
+					case <-done:
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	progress(string(stateCreated), containerID)
+
+	go func() {
+		httpClient, err := masterHTTPClient(configDir)
+		if err != nil {
+			result <- err
+			return
+		}
+		masterHost := fmt.Sprintf("%s:8443", serverIP)
+
+		if err := dialWithBackoff(masterHost, died, done); err != nil {
+			result <- h.wrapDeathError(containerID, err)
+			return
+		}
+		progress(string(stateAPIListening), masterHost)
+
+		healthzURL := h.healthzReadyURL(serverIP)
+		if err := pollHealthzWithBackoff(httpClient, healthzURL, died, done); err != nil {
+			result <- h.wrapDeathError(containerID, err)
+			return
+		}
+		progress(string(stateHealthzReady), healthzURL)
+		progress(string(stateReady), "")
+		result <- nil
+	}()
+
+	return result
+}
+
+// backoff returns successive exponential backoff durations with jitter.
+// The exponential part starts at backoffBase and is capped at backoffCap;
+// up to 25% of that value is then added as jitter, so a result can exceed
+// backoffCap by as much as backoffCap/4.
+func backoff(attempt int) time.Duration {
+	d := backoffBase << uint(attempt)
+	if d > backoffCap || d <= 0 {
+		d = backoffCap
+	}
+	jitter := time.Duration(rand.Int63n(int64(d) / 4))
+	return d + jitter
+}
+
+func dialWithBackoff(hostPort string, died <-chan string, done <-chan struct{}) error {
+	for attempt := 0; ; attempt++ {
+		select {
+		case status := <-died:
+			return fmt.Errorf("container %s before API server started listening", status)
+		case <-done:
+			return fmt.Errorf("timed out waiting for API server to start listening")
+		default:
+		}
+		conn, err := dialTCP(hostPort, 2*time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-time.After(backoff(attempt)):
+		case status := <-died:
+			return fmt.Errorf("container %s before API server started listening", status)
+		case <-done:
+			return fmt.Errorf("timed out waiting for API server to start listening")
+		}
+	}
+}
+
+func pollHealthzWithBackoff(client *http.Client, url string, died <-chan string, done <-chan struct{}) error {
+	for attempt := 0; ; attempt++ {
+		select {
+		case status := <-died:
+			return fmt.Errorf("container %s before reporting healthy", status)
+		case <-done:
+			return fmt.Errorf("timed out waiting for healthz readiness")
+		default:
+		}
+		resp, err := client.Get(url)
+		if err == nil {
+			ok := resp.StatusCode == http.StatusOK
+			resp.Body.Close()
+			if ok {
+				return nil
+			}
+		}
+		select {
+		case <-time.After(backoff(attempt)):
+		case status := <-died:
+			return fmt.Errorf("container %s before reporting healthy", status)
+		case <-done:
+			return fmt.Errorf("timed out waiting for healthz readiness")
+		}
+	}
+}
+
+// wrapDeathError attaches the container's trailing log output to err when
+// the container has died, so that callers see why the daemon failed
+// instead of a generic timeout.
+func (h *Helper) wrapDeathError(containerID string, cause error) error {
+	logs, logErr := h.dockerHelper.Logs(containerID, lastLogLines)
+	if logErr != nil {
+		return errors.NewError("OpenShift container %s did not become ready", h.containerName).WithCause(cause)
+	}
+	return errors.NewError("OpenShift container %s did not become ready:\n%s", h.containerName, logs).WithCause(cause)
+}
+
+func dialTCP(hostPort string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", hostPort, timeout)
+}
@@ -0,0 +1,22 @@
+package openshift
+
+import "testing"
+
+func TestBackoffStartsNearBase(t *testing.T) {
+	d := backoff(0)
+	if d < backoffBase || d > backoffBase+backoffBase/4 {
+		t.Fatalf("backoff(0) = %v, want within [%v, %v]", d, backoffBase, backoffBase+backoffBase/4)
+	}
+}
+
+func TestBackoffCapsAndSurvivesOverflow(t *testing.T) {
+	for _, attempt := range []int{1, 5, 10, 30, 63, 64, 1000} {
+		d := backoff(attempt)
+		if d <= 0 {
+			t.Fatalf("backoff(%d) returned non-positive duration %v", attempt, d)
+		}
+		if d > backoffCap+backoffCap/4 {
+			t.Fatalf("backoff(%d) = %v, want capped within [%v, %v]", attempt, d, backoffCap, backoffCap+backoffCap/4)
+		}
+	}
+}
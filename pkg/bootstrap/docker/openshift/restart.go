@@ -0,0 +1,106 @@
+package openshift
+
+import (
+	"fmt"
+
+	docker "github.com/fsouza/go-dockerclient"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/errors"
+)
+
+// Resume looks for a container matching h.containerName and, if it is
+// already running, waits for it to become ready without creating or
+// starting anything new. It returns ErrOpenShiftFailedToStart if no such
+// container exists or it is not running.
+func (h *Helper) Resume(opt *StartOptions) (string, error) {
+	containerID, running, err := h.dockerHelper.GetContainerState(h.containerName)
+	if err != nil {
+		return "", errors.NewError("cannot get state of OpenShift container %s", h.containerName).WithCause(err)
+	}
+	if !running {
+		return "", ErrOpenShiftFailedToStart(h.containerName)
+	}
+
+	txn := newTransaction(h.client, h.dockerHelper)
+	defer func() {
+		errors.LogError(txn.Rollback())
+	}()
+
+	configDir, err := h.copyConfig(opt.HostConfigDir)
+	if err != nil {
+		return "", errors.NewError("could not copy OpenShift configuration").WithCause(err)
+	}
+	txn.addTempDir(configDir)
+
+	h.reporter.PhaseStarted("Resuming existing OpenShift container", Fields{"container": h.containerName})
+	events, err := h.subscribeEvents()
+	if err != nil {
+		h.reporter.PhaseFailed("Resuming existing OpenShift container", err, nil)
+		return "", err
+	}
+	progress := func(string, string) {}
+	if err := h.waitForReady(containerID, events, opt, opt.ServerIP, configDir, progress); err != nil {
+		h.reporter.PhaseFailed("Resuming existing OpenShift container", err, nil)
+		return "", err
+	}
+	h.reporter.PhaseCompleted("Resuming existing OpenShift container", nil)
+	txn.Commit()
+	return configDir, nil
+}
+
+// Restart reuses an existing container matching h.containerName when it is
+// running and its image and bind mounts already match opt (the fast path: just re-run the
+// healthz wait), or cleanly stops and removes it so Start can replace it.
+func (h *Helper) Restart(opt *StartOptions) (string, error) {
+	info, err := h.client.InspectContainer(h.containerName)
+	if err != nil {
+		// No existing container to restart - this is just a Start.
+		return h.Start(opt)
+	}
+
+	if info.State.Running && h.matchesExisting(info, opt) {
+		return h.Resume(opt)
+	}
+
+	h.reporter.Info("Replacing existing OpenShift container", Fields{"container": h.containerName})
+	if err := h.dockerHelper.StopAndRemoveContainer(h.containerName); err != nil {
+		return "", errors.NewError("could not remove existing OpenShift container %s", h.containerName).WithCause(err)
+	}
+	return h.Start(opt)
+}
+
+// matchesExisting reports whether an already-running container was
+// created from the same image and bind mounts that opt would produce,
+// meaning it can be reused as-is rather than replaced.
+func (h *Helper) matchesExisting(info *docker.Container, opt *StartOptions) bool {
+	if info.Config == nil || info.Config.Image != h.image || info.HostConfig == nil {
+		return false
+	}
+	platform, err := h.getHostPlatform()
+	if err != nil {
+		return false
+	}
+	wantBinds := platform.RequiredBinds()
+	if opt.UseSharedVolume {
+		wantBinds = append(wantBinds, fmt.Sprintf("%[1]s:%[1]s:shared", opt.HostVolumesDir))
+	} else {
+		wantBinds = append(wantBinds, fmt.Sprintf("%[1]s:%[1]s", opt.HostVolumesDir))
+	}
+	wantBinds = append(wantBinds, fmt.Sprintf("%s:/var/lib/origin/openshift.local.config:z", opt.HostConfigDir))
+	if len(opt.HostDataDir) > 0 {
+		wantBinds = append(wantBinds, fmt.Sprintf("%s:/var/lib/origin/openshift.local.etcd:z", opt.HostDataDir))
+	}
+	if len(info.HostConfig.Binds) != len(wantBinds) {
+		return false
+	}
+	have := map[string]struct{}{}
+	for _, b := range info.HostConfig.Binds {
+		have[b] = struct{}{}
+	}
+	for _, b := range wantBinds {
+		if _, ok := have[b]; !ok {
+			return false
+		}
+	}
+	return true
+}
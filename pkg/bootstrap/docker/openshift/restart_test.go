@@ -0,0 +1,69 @@
+package openshift
+
+import (
+	"testing"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+type fakeHostPlatform struct{}
+
+func (fakeHostPlatform) RequiredBinds() []string          { return []string{"/var/run:/var/run:rw"} }
+func (fakeHostPlatform) PortInUse(p []int) ([]int, error) { return nil, nil }
+func (fakeHostPlatform) HostRootFS() string               { return "/rootfs" }
+
+func TestMatchesExisting(t *testing.T) {
+	h := &Helper{image: "openshift/origin:v1.0", hostPlatform: fakeHostPlatform{}}
+	opt := &StartOptions{HostVolumesDir: "/host/volumes", HostConfigDir: "/host/config"}
+
+	wantBinds := []string{
+		"/var/run:/var/run:rw",
+		"/host/volumes:/host/volumes",
+		"/host/config:/var/lib/origin/openshift.local.config:z",
+	}
+	info := &docker.Container{
+		Config:     &docker.Config{Image: h.image},
+		HostConfig: &docker.HostConfig{Binds: wantBinds},
+	}
+
+	if !h.matchesExisting(info, opt) {
+		t.Fatalf("expected matching image and binds to be reused")
+	}
+
+	opt.HostDataDir = "/host/data"
+	if h.matchesExisting(info, opt) {
+		t.Fatalf("expected the extra HostDataDir bind required by opt to make the existing container stale")
+	}
+
+	info.HostConfig.Binds = append(wantBinds, "/host/data:/var/lib/origin/openshift.local.etcd:z")
+	if !h.matchesExisting(info, opt) {
+		t.Fatalf("expected matching binds including HostDataDir to be reused")
+	}
+
+	info.Config.Image = "openshift/origin:other"
+	if h.matchesExisting(info, opt) {
+		t.Fatalf("expected a different image to not match")
+	}
+}
+
+func TestMatchesExistingSharedVolume(t *testing.T) {
+	h := &Helper{image: "openshift/origin:v1.0", hostPlatform: fakeHostPlatform{}}
+	opt := &StartOptions{HostVolumesDir: "/host/volumes", HostConfigDir: "/host/config", UseSharedVolume: true}
+
+	info := &docker.Container{
+		Config: &docker.Config{Image: h.image},
+		HostConfig: &docker.HostConfig{Binds: []string{
+			"/var/run:/var/run:rw",
+			"/host/volumes:/host/volumes",
+			"/host/config:/var/lib/origin/openshift.local.config:z",
+		}},
+	}
+	if h.matchesExisting(info, opt) {
+		t.Fatalf("expected the non-shared volumes bind to not match a UseSharedVolume request")
+	}
+
+	info.HostConfig.Binds[1] = "/host/volumes:/host/volumes:shared"
+	if !h.matchesExisting(info, opt) {
+		t.Fatalf("expected the shared volumes bind to match a UseSharedVolume request")
+	}
+}
@@ -0,0 +1,86 @@
+package openshift
+
+import (
+	"os"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/dockerhelper"
+	"github.com/openshift/origin/pkg/bootstrap/docker/errors"
+)
+
+// Transaction records every side effect Start performs - created
+// containers, pulled images, and written temp directories - so that a
+// failure partway through can be rolled back cleanly instead of leaving
+// a container running or an image pulled for nothing.
+type Transaction struct {
+	client       *docker.Client
+	dockerHelper *dockerhelper.Helper
+	containerIDs []string
+	pulledImages []string
+	tempDirs     []string
+	committed    bool
+}
+
+// newTransaction creates an empty Transaction bound to client and
+// dockerHelper, used to undo any side effect it records on Rollback.
+func newTransaction(client *docker.Client, dockerHelper *dockerhelper.Helper) *Transaction {
+	return &Transaction{client: client, dockerHelper: dockerHelper}
+}
+
+// addContainer records a created container id to be stopped and removed
+// on Rollback.
+func (t *Transaction) addContainer(id string) {
+	t.containerIDs = append(t.containerIDs, id)
+}
+
+// addPulledImage records an image that was not present locally before
+// Start pulled it, to be removed on Rollback.
+func (t *Transaction) addPulledImage(image string) {
+	t.pulledImages = append(t.pulledImages, image)
+}
+
+// addTempDir records a directory to be removed on Rollback.
+func (t *Transaction) addTempDir(dir string) {
+	t.tempDirs = append(t.tempDirs, dir)
+}
+
+// Commit marks the transaction as successful; Rollback becomes a no-op.
+func (t *Transaction) Commit() {
+	t.committed = true
+}
+
+// Rollback undoes every side effect recorded on the transaction. It is
+// safe to call after Commit, in which case it does nothing. Rollback
+// collects and logs errors for each side effect rather than stopping at
+// the first one, since callers rarely have a meaningful fallback to take
+// once they're already recovering from a failed Start.
+func (t *Transaction) Rollback() error {
+	if t.committed {
+		return nil
+	}
+	var rollbackErrors []error
+	for _, id := range t.containerIDs {
+		if err := t.dockerHelper.StopAndRemoveContainer(id); err != nil {
+			rollbackErrors = append(rollbackErrors, err)
+		}
+	}
+	for _, image := range t.pulledImages {
+		if err := t.client.RemoveImage(image); err != nil {
+			rollbackErrors = append(rollbackErrors, err)
+		}
+	}
+	for _, dir := range t.tempDirs {
+		if err := os.RemoveAll(dir); err != nil {
+			rollbackErrors = append(rollbackErrors, err)
+		}
+	}
+	if len(rollbackErrors) > 0 {
+		for _, err := range rollbackErrors {
+			glog.V(2).Infof("Error during rollback: %v", err)
+		}
+		return errors.NewError("could not cleanly roll back failed start").WithCause(rollbackErrors[0])
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package openshift
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openshift/origin/pkg/bootstrap/docker/dockerhelper"
+)
+
+func TestTransactionCommitSkipsRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	txn := newTransaction(nil, dockerhelper.NewHelper(nil))
+	txn.addTempDir(dir)
+	txn.Commit()
+
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("expected Rollback to be a no-op after Commit, got: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected temp dir to survive a Rollback after Commit, got: %v", err)
+	}
+}
+
+func TestTransactionRollbackRemovesTempDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nested := filepath.Join(dir, "config")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	txn := newTransaction(nil, dockerhelper.NewHelper(nil))
+	txn.addTempDir(dir)
+
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("unexpected error from Rollback: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected temp dir %s to be removed by Rollback", dir)
+	}
+}